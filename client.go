@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// NewK8sClient builds a *kubernetes.Clientset for contextName out of the
+// kubeconfig at kubeconfigPath. When the KUBERNETES_SERVICE_HOST env var is
+// set (i.e. we're running as a Pod) it ignores the kubeconfig entirely and
+// uses rest.InClusterConfig() instead, since contextName has no meaning
+// in-cluster. It returns the client and nil if sucessful, or a nil client
+// and the error if one is encourted.
+func NewK8sClient(logger *slog.Logger, kubeconfigPath string, contextName string) (*kubernetes.Clientset, error) {
+	if inCluster() {
+		logger.Info("KUBERNETES_SERVICE_HOST detected, using in-cluster config")
+		inClusterConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load in-cluster config: %s", err.Error())
+		}
+		return kubernetes.NewForConfig(inClusterConfig)
+	}
+
+	config, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig from file %s", err.Error())
+	}
+
+	if _, exists := config.Contexts[contextName]; !exists {
+		return nil, fmt.Errorf("kubecontext does not exist in the kubeconfig %s", contextName)
+	}
+
+	config.CurrentContext = contextName
+	k8sConfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(k8sConfig)
+}
+
+// ClientCache lazily builds and caches a *kubernetes.Clientset per
+// kubeconfig context, so redeployWorkloads can fan out across multiple
+// clusters without reconstructing a client for each run.
+type ClientCache struct {
+	kubeconfigPath string
+	logger         *slog.Logger
+
+	mu      sync.Mutex
+	clients map[string]*kubernetes.Clientset
+}
+
+// NewClientCache returns a ClientCache that builds clients from the
+// kubeconfig at kubeconfigPath.
+func NewClientCache(kubeconfigPath string, logger *slog.Logger) *ClientCache {
+	return &ClientCache{
+		kubeconfigPath: kubeconfigPath,
+		logger:         logger,
+		clients:        make(map[string]*kubernetes.Clientset),
+	}
+}
+
+// ForContext returns the cached client for contextName, constructing and
+// caching one if this is the first request for that context.
+func (c *ClientCache) ForContext(contextName string) (*kubernetes.Clientset, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[contextName]; ok {
+		return client, nil
+	}
+
+	client, err := NewK8sClient(c.logger, c.kubeconfigPath, contextName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build client for context %s: %s", contextName, err.Error())
+	}
+
+	c.clients[contextName] = client
+	return client, nil
+}
+
+// AllContexts returns every context name defined in the cache's
+// kubeconfig, for use with --all-contexts. When running in-cluster (see
+// NewK8sClient), there's no kubeconfig to read contexts from, so it
+// returns the single in-cluster sentinel context ("").
+func (c *ClientCache) AllContexts() ([]string, error) {
+	if inCluster() {
+		return []string{""}, nil
+	}
+
+	config, err := clientcmd.LoadFromFile(c.kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig from file %s", err.Error())
+	}
+
+	var contexts []string
+	for name := range config.Contexts {
+		contexts = append(contexts, name)
+	}
+	return contexts, nil
+}
+
+// CurrentContext returns the kubeconfig's current-context, for use when
+// neither --contexts nor --all-contexts was given. When running in-cluster
+// (see NewK8sClient), there's no kubeconfig and contextName has no
+// meaning, so it returns the in-cluster sentinel context ("") without
+// touching the kubeconfig file.
+func (c *ClientCache) CurrentContext() (string, error) {
+	if inCluster() {
+		return "", nil
+	}
+
+	config, err := clientcmd.LoadFromFile(c.kubeconfigPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load kubeconfig from file %s", err.Error())
+	}
+	if config.CurrentContext == "" {
+		return "", fmt.Errorf("kubeconfig %s has no current-context set", c.kubeconfigPath)
+	}
+	return config.CurrentContext, nil
+}
+
+// inCluster reports whether the process is running as a Pod, the same
+// check NewK8sClient uses to decide between rest.InClusterConfig() and a
+// kubeconfig context.
+func inCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
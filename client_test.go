@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"testing"
+)
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+  - name: prod-cluster
+    cluster:
+      server: https://prod.example.com
+  - name: staging-cluster
+    cluster:
+      server: https://staging.example.com
+contexts:
+  - name: prod
+    context:
+      cluster: prod-cluster
+  - name: staging
+    context:
+      cluster: staging-cluster
+`
+
+func writeTestKubeconfig(t *testing.T) string {
+	t.Helper()
+	path := t.TempDir() + "/kubeconfig.yaml"
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0o644); err != nil {
+		t.Fatalf("failed to write test kubeconfig: %s", err)
+	}
+	return path
+}
+
+func TestResolveContextsAllContexts(t *testing.T) {
+	cache := NewClientCache(writeTestKubeconfig(t), nil)
+
+	contexts, err := resolveContexts(cache, "", true)
+	if err != nil {
+		t.Fatalf("resolveContexts returned error: %s", err)
+	}
+	sort.Strings(contexts)
+	if len(contexts) != 2 || contexts[0] != "prod" || contexts[1] != "staging" {
+		t.Errorf("expected [prod staging], got %v", contexts)
+	}
+}
+
+func TestResolveContextsExplicitList(t *testing.T) {
+	cache := NewClientCache(writeTestKubeconfig(t), nil)
+
+	contexts, err := resolveContexts(cache, "staging, prod", false)
+	if err != nil {
+		t.Fatalf("resolveContexts returned error: %s", err)
+	}
+	if len(contexts) != 2 || contexts[0] != "staging" || contexts[1] != "prod" {
+		t.Errorf("expected [staging prod], got %v", contexts)
+	}
+}
+
+func TestResolveContextsDefaultsToCurrentContext(t *testing.T) {
+	cache := NewClientCache(writeTestKubeconfig(t), nil)
+
+	contexts, err := resolveContexts(cache, "", false)
+	if err != nil {
+		t.Fatalf("resolveContexts returned error: %s", err)
+	}
+	if len(contexts) != 1 || contexts[0] != "prod" {
+		t.Errorf("expected [prod] (the kubeconfig's current-context), got %v", contexts)
+	}
+}
+
+// TestResolveContextsInCluster verifies that, when running as a Pod, the
+// zero-flag and --all-contexts paths fall back to the in-cluster sentinel
+// context without ever reading the (nonexistent) kubeconfig file.
+func TestResolveContextsInCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	cache := NewClientCache("/nonexistent/kubeconfig.yaml", nil)
+
+	contexts, err := resolveContexts(cache, "", false)
+	if err != nil {
+		t.Fatalf("resolveContexts returned error: %s", err)
+	}
+	if len(contexts) != 1 || contexts[0] != "" {
+		t.Errorf("expected [\"\"] (the in-cluster sentinel context), got %v", contexts)
+	}
+
+	contexts, err = resolveContexts(cache, "", true)
+	if err != nil {
+		t.Fatalf("resolveContexts --all-contexts returned error: %s", err)
+	}
+	if len(contexts) != 1 || contexts[0] != "" {
+		t.Errorf("expected [\"\"] from --all-contexts in-cluster, got %v", contexts)
+	}
+}
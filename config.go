@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule describes a single selector/action pair loaded from the redeployer
+// config file. A workload matches a Rule when its namespace matches
+// Namespace (a glob), NameRegex and LabelSelector both match (each is
+// checked only when set), and the workload is at least MinAge old.
+type Rule struct {
+	Namespace     string            `json:"namespace" yaml:"namespace"`
+	NameRegex     string            `json:"nameRegex" yaml:"nameRegex"`
+	LabelSelector string            `json:"labelSelector" yaml:"labelSelector"`
+	Annotations   map[string]string `json:"annotations" yaml:"annotations"`
+	MinAge        string            `json:"minAge" yaml:"minAge"`
+	Strategy      string            `json:"strategy" yaml:"strategy"`
+
+	nameRegex *regexp.Regexp
+	minAge    time.Duration
+}
+
+// Strategy values accepted in Rule.Strategy.
+const (
+	StrategyPatchAnnotation = "patch-annotation"
+	StrategyRolloutRestart  = "rollout-restart"
+	StrategyDeletePod       = "delete-pod"
+)
+
+// Config is the top level shape of the redeployer config file.
+type Config struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// LoadConfig reads a Config from path. The format (JSON or YAML) is inferred
+// from the file extension; .json is parsed as JSON, anything else (.yaml,
+// .yml) is parsed as YAML.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config file %s: %s", path, err.Error())
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse json config %s: %s", path, err.Error())
+		}
+	default:
+		if err := yaml.Unmarshal(raw, &cfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse yaml config %s: %s", path, err.Error())
+		}
+	}
+
+	for i := range cfg.Rules {
+		r := &cfg.Rules[i]
+		if r.Strategy == "" {
+			r.Strategy = StrategyPatchAnnotation
+		}
+		if r.NameRegex != "" {
+			re, err := regexp.Compile(r.NameRegex)
+			if err != nil {
+				return cfg, fmt.Errorf("rule %d: invalid nameRegex %q: %s", i, r.NameRegex, err.Error())
+			}
+			r.nameRegex = re
+		}
+		if r.MinAge != "" {
+			d, err := time.ParseDuration(r.MinAge)
+			if err != nil {
+				return cfg, fmt.Errorf("rule %d: invalid minAge %q: %s", i, r.MinAge, err.Error())
+			}
+			r.minAge = d
+		}
+	}
+
+	return cfg, nil
+}
+
+// Matches reports whether name/namespace/labels/createdAt satisfy the
+// rule's namespace glob, its name regex and its label selector (each only
+// when set), and MinAge.
+func (r Rule) Matches(namespace, name string, labelMap map[string]string, createdAt time.Time) (bool, error) {
+	if r.Namespace != "" {
+		ok, err := filepath.Match(r.Namespace, namespace)
+		if err != nil {
+			return false, fmt.Errorf("invalid namespace glob %q: %s", r.Namespace, err.Error())
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	if r.nameRegex != nil {
+		if !r.nameRegex.MatchString(name) {
+			return false, nil
+		}
+	}
+
+	if r.LabelSelector != "" {
+		sel, err := labels.Parse(r.LabelSelector)
+		if err != nil {
+			return false, fmt.Errorf("invalid labelSelector %q: %s", r.LabelSelector, err.Error())
+		}
+		if !sel.Matches(labels.Set(labelMap)) {
+			return false, nil
+		}
+	}
+
+	if r.minAge > 0 && time.Since(createdAt) < r.minAge {
+		return false, nil
+	}
+
+	return true, nil
+}
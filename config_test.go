@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRuleMatchesNamespaceGlob(t *testing.T) {
+	r := Rule{Namespace: "prod-*"}
+
+	ok, err := r.Matches("prod-payments", "api", nil, time.Time{})
+	if err != nil {
+		t.Fatalf("Matches returned error: %s", err)
+	}
+	if !ok {
+		t.Error("expected prod-payments to match glob prod-*")
+	}
+
+	ok, err = r.Matches("staging", "api", nil, time.Time{})
+	if err != nil {
+		t.Fatalf("Matches returned error: %s", err)
+	}
+	if ok {
+		t.Error("expected staging not to match glob prod-*")
+	}
+}
+
+func TestRuleMatchesNameRegex(t *testing.T) {
+	cfg, err := LoadConfig(writeTestConfig(t, `rules:
+  - nameRegex: "^db-.*"
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %s", err)
+	}
+	rule := cfg.Rules[0]
+
+	ok, err := rule.Matches("default", "db-primary", nil, time.Time{})
+	if err != nil {
+		t.Fatalf("Matches returned error: %s", err)
+	}
+	if !ok {
+		t.Error("expected db-primary to match ^db-.*")
+	}
+
+	ok, err = rule.Matches("default", "web-frontend", nil, time.Time{})
+	if err != nil {
+		t.Fatalf("Matches returned error: %s", err)
+	}
+	if ok {
+		t.Error("expected web-frontend not to match ^db-.*")
+	}
+}
+
+func TestRuleMatchesLabelSelector(t *testing.T) {
+	r := Rule{LabelSelector: "tier=database"}
+
+	ok, err := r.Matches("default", "api", map[string]string{"tier": "database"}, time.Time{})
+	if err != nil {
+		t.Fatalf("Matches returned error: %s", err)
+	}
+	if !ok {
+		t.Error("expected labels {tier: database} to match tier=database")
+	}
+
+	ok, err = r.Matches("default", "api", map[string]string{"tier": "frontend"}, time.Time{})
+	if err != nil {
+		t.Fatalf("Matches returned error: %s", err)
+	}
+	if ok {
+		t.Error("expected labels {tier: frontend} not to match tier=database")
+	}
+}
+
+func TestRuleMatchesMinAge(t *testing.T) {
+	cfg, err := LoadConfig(writeTestConfig(t, `rules:
+  - minAge: 24h
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %s", err)
+	}
+	rule := cfg.Rules[0]
+
+	ok, err := rule.Matches("default", "api", nil, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Matches returned error: %s", err)
+	}
+	if ok {
+		t.Error("expected a 1h-old workload not to match minAge: 24h")
+	}
+
+	ok, err = rule.Matches("default", "api", nil, time.Now().Add(-48*time.Hour))
+	if err != nil {
+		t.Fatalf("Matches returned error: %s", err)
+	}
+	if !ok {
+		t.Error("expected a 48h-old workload to match minAge: 24h")
+	}
+}
+
+func TestLoadConfigInvalidMinAge(t *testing.T) {
+	_, err := LoadConfig(writeTestConfig(t, `rules:
+  - minAge: "not-a-duration"
+`))
+	if err == nil {
+		t.Error("expected an error for an unparseable minAge")
+	}
+}
+
+// writeTestConfig writes contents to a temp .yaml file and returns its path.
+func writeTestConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := t.TempDir() + "/config.yaml"
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("failed to write test config: %s", err)
+	}
+	return path
+}
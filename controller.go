@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/util/workqueue"
+
+	"k8s-redeployer/pkg/metrics"
+)
+
+// workItem identifies a single workload to reconcile.
+type workItem struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+// Controller watches Deployments, StatefulSets, and DaemonSets and
+// reconciles any that match cfg's rules against a rate-limited work
+// queue, instead of the old list-everything-then-patch polling loop.
+type Controller struct {
+	client                kubernetes.Clientset
+	cfg                   Config
+	filterLabel           string
+	rolloutOpts           RolloutOptions
+	dryRunOpts            DryRunOptions
+	maxUnavailablePercent int
+	logger                *slog.Logger
+
+	factory informers.SharedInformerFactory
+
+	deploymentLister  appslisters.DeploymentLister
+	statefulSetLister appslisters.StatefulSetLister
+	daemonSetLister   appslisters.DaemonSetLister
+
+	deploymentsSynced  cache.InformerSynced
+	statefulSetsSynced cache.InformerSynced
+	daemonSetsSynced   cache.InformerSynced
+
+	queue workqueue.RateLimitingInterface
+
+	synced atomic.Bool
+
+	reconciledMu sync.Mutex
+	// reconciledGeneration records, per workload, the metadata.generation
+	// we've already redeployed for. Rule matching (e.g. minAge) is
+	// level-triggered on fields like CreationTimestamp that never change,
+	// so without this a workload would match forever and get re-patched
+	// on every event our own patch itself produces. (Periodic informer
+	// resyncs are already dropped by objectChanged.)
+	reconciledGeneration map[workItem]int64
+}
+
+// NewController wires up a Controller over client, with cfg as the rule
+// set to evaluate on every workload event. filterLabel, when non-empty,
+// additionally restricts reconciliation to workloads matching that label
+// selector (see --filter-label). maxUnavailablePercent gates each
+// reconcile the same way --max-unavailable-percent gates the oneshot path
+// (see checkMaxUnavailablePercent); 0 disables the guard.
+func NewController(client kubernetes.Clientset, cfg Config, filterLabel string, rolloutOpts RolloutOptions, dryRunOpts DryRunOptions, maxUnavailablePercent int, logger *slog.Logger) *Controller {
+	factory := informers.NewSharedInformerFactory(&client, 30*time.Second)
+
+	deployments := factory.Apps().V1().Deployments()
+	statefulSets := factory.Apps().V1().StatefulSets()
+	daemonSets := factory.Apps().V1().DaemonSets()
+
+	c := &Controller{
+		client:                client,
+		cfg:                   cfg,
+		filterLabel:           filterLabel,
+		rolloutOpts:           rolloutOpts,
+		dryRunOpts:            dryRunOpts,
+		maxUnavailablePercent: maxUnavailablePercent,
+		logger:                logger,
+		factory:               factory,
+		deploymentLister:      deployments.Lister(),
+		statefulSetLister:     statefulSets.Lister(),
+		daemonSetLister:       daemonSets.Lister(),
+		deploymentsSynced:     deployments.Informer().HasSynced,
+		statefulSetsSynced:    statefulSets.Informer().HasSynced,
+		daemonSetsSynced:      daemonSets.Informer().HasSynced,
+		queue:                 workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		reconciledGeneration:  make(map[workItem]int64),
+	}
+
+	registerHandler(deployments.Informer(), "Deployment", c.queue)
+	registerHandler(statefulSets.Informer(), "StatefulSet", c.queue)
+	registerHandler(daemonSets.Informer(), "DaemonSet", c.queue)
+
+	return c
+}
+
+// registerHandler wires a SharedIndexInformer's add/update/delete events to
+// enqueue a workItem of the given kind onto queue.
+func registerHandler(informer cache.SharedIndexInformer, kind string, queue workqueue.RateLimitingInterface) {
+	enqueue := func(obj any) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			runtime.HandleError(err)
+			return
+		}
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			runtime.HandleError(err)
+			return
+		}
+		queue.Add(workItem{kind: kind, namespace: namespace, name: name})
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) { enqueue(obj) },
+		UpdateFunc: func(old, new any) {
+			if !objectChanged(old, new) {
+				return
+			}
+			enqueue(new)
+		},
+		DeleteFunc: func(obj any) { enqueue(obj) },
+	})
+}
+
+// objectChanged reports whether new is actually a different revision of
+// old, as opposed to client-go's informer delivering the same object again
+// on its periodic resync. Comparing ResourceVersion is the standard way to
+// tell the two apart: it's unchanged on a resync and always bumped on a
+// real write.
+func objectChanged(old, new any) bool {
+	oldMeta, err := meta.Accessor(old)
+	if err != nil {
+		return true
+	}
+	newMeta, err := meta.Accessor(new)
+	if err != nil {
+		return true
+	}
+	return oldMeta.GetResourceVersion() != newMeta.GetResourceVersion()
+}
+
+// Run starts the informers, waits for their caches to sync, then runs
+// numWorkers reconcile loops until ctx is cancelled.
+func (c *Controller) Run(ctx context.Context, numWorkers int) error {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	c.logger.Info("starting redeployer controller")
+	c.factory.Start(ctx.Done())
+
+	c.logger.Info("waiting for informer caches to sync")
+	if ok := cache.WaitForCacheSync(ctx.Done(), c.deploymentsSynced, c.statefulSetsSynced, c.daemonSetsSynced); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+	c.synced.Store(true)
+
+	c.logger.With("workers", numWorkers).Info("starting workers")
+	for i := 0; i < numWorkers; i++ {
+		go wait.Until(func() { c.runWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+	c.logger.Info("shutting down redeployer controller")
+	return nil
+}
+
+// RunWithLeaderElection wraps Run so only the elected leader among multiple
+// replicas reconciles, preventing concurrent replicas from double-patching
+// the same workload. identity should be unique per replica (e.g. pod name).
+func (c *Controller) RunWithLeaderElection(ctx context.Context, numWorkers int, lock resourcelock.Interface, identity string) error {
+	runErr := make(chan error, 1)
+	var startedLeading atomic.Bool
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				startedLeading.Store(true)
+				c.logger.With("identity", identity).Info("started leading")
+				runErr <- c.Run(ctx, numWorkers)
+			},
+			OnStoppedLeading: func() {
+				c.logger.With("identity", identity).Info("stopped leading")
+			},
+			OnNewLeader: func(currentID string) {
+				if currentID != identity {
+					c.logger.With("leader", currentID).Info("observed new leader")
+				}
+			},
+		},
+	})
+
+	// RunOrDie calls OnStartedLeading in its own goroutine and can return
+	// before that goroutine's c.Run has finished writing to runErr, so a
+	// non-blocking select here would race and silently report success. If
+	// we never became leader (e.g. ctx was cancelled before we acquired the
+	// lease), runErr is never written and blocking on it would hang, so
+	// only block when we know a writer is on its way.
+	if !startedLeading.Load() {
+		return ctx.Err()
+	}
+	return <-runErr
+}
+
+// Ready reports whether this controller's informer caches have synced, for
+// use as part of the process's /readyz check.
+func (c *Controller) Ready() bool {
+	return c.synced.Load()
+}
+
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	item, ok := obj.(workItem)
+	if !ok {
+		c.queue.Forget(obj)
+		runtime.HandleError(fmt.Errorf("unexpected item in workqueue: %#v", obj))
+		return true
+	}
+
+	if err := c.sync(ctx, item); err != nil {
+		c.queue.AddRateLimited(item)
+		runtime.HandleError(fmt.Errorf("sync %s %s/%s failed, requeuing: %s", item.kind, item.namespace, item.name, err.Error()))
+		return true
+	}
+
+	c.queue.Forget(obj)
+	metrics.MarkAlive()
+	return true
+}
+
+// sync reconciles a single workload: it looks the object up via the
+// informer's lister, checks it against cfg's rules, and applies the
+// matching rule's strategy.
+func (c *Controller) sync(ctx context.Context, item workItem) error {
+	namespace, name, labels, selector, createdAt, generation, exists, err := c.lookup(item)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// object was deleted; nothing to reconcile
+		c.reconciledMu.Lock()
+		delete(c.reconciledGeneration, item)
+		c.reconciledMu.Unlock()
+		return nil
+	}
+
+	rule, ok, err := matchRuleFiltered(c.cfg, c.filterLabel, namespace, name, labels, createdAt)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	c.reconciledMu.Lock()
+	alreadyReconciled := c.reconciledGeneration[item] >= generation
+	c.reconciledMu.Unlock()
+	if alreadyReconciled {
+		return nil
+	}
+
+	w := matchedWorkload{kind: item.kind, name: name, namespace: namespace, labels: selector, rule: rule}
+
+	matched, err := c.matchedWorkloads(ctx)
+	if err != nil {
+		return err
+	}
+	if err := checkMaxUnavailablePercent(ctx, c.client, matched, c.maxUnavailablePercent); err != nil {
+		return err
+	}
+
+	details, err := redeployWorkload(ctx, c.client, w, c.rolloutOpts, c.dryRunOpts)
+	if err != nil {
+		return err
+	}
+
+	if c.dryRunOpts.Mode != DryRunNone {
+		c.logger.With("kind", details.Kind, "workload", details.Name, "namespace", namespace, "planned", len(details.Planned)).Info("dry-run: would reconcile workload")
+		return nil
+	}
+
+	// redeployWorkload's own patch bumps generation by 1; recording that
+	// watermark now means the update event it produces is recognized as
+	// already-handled instead of re-triggering this same redeploy.
+	c.reconciledMu.Lock()
+	c.reconciledGeneration[item] = generation + 1
+	c.reconciledMu.Unlock()
+
+	c.logger.With("kind", details.Kind, "workload", details.Name, "namespace", namespace).Info("sucessfully reconciled workload")
+	return nil
+}
+
+// lookup fetches the object named by item from the appropriate lister and
+// returns its namespace, name, labels, pod label selector, creation
+// timestamp, and generation.
+func (c *Controller) lookup(item workItem) (namespace, name string, labels map[string]string, selector string, createdAt time.Time, generation int64, exists bool, err error) {
+	switch item.kind {
+	case "Deployment":
+		d, err := c.deploymentLister.Deployments(item.namespace).Get(item.name)
+		if apierrors.IsNotFound(err) {
+			return "", "", nil, "", time.Time{}, 0, false, nil
+		}
+		if err != nil {
+			metrics.RecordAPIError("get")
+			return "", "", nil, "", time.Time{}, 0, false, err
+		}
+		return d.Namespace, d.Name, d.Labels, metav1.FormatLabelSelector(d.Spec.Selector), d.CreationTimestamp.Time, d.Generation, true, nil
+	case "StatefulSet":
+		s, err := c.statefulSetLister.StatefulSets(item.namespace).Get(item.name)
+		if apierrors.IsNotFound(err) {
+			return "", "", nil, "", time.Time{}, 0, false, nil
+		}
+		if err != nil {
+			metrics.RecordAPIError("get")
+			return "", "", nil, "", time.Time{}, 0, false, err
+		}
+		return s.Namespace, s.Name, s.Labels, metav1.FormatLabelSelector(s.Spec.Selector), s.CreationTimestamp.Time, s.Generation, true, nil
+	case "DaemonSet":
+		ds, err := c.daemonSetLister.DaemonSets(item.namespace).Get(item.name)
+		if apierrors.IsNotFound(err) {
+			return "", "", nil, "", time.Time{}, 0, false, nil
+		}
+		if err != nil {
+			metrics.RecordAPIError("get")
+			return "", "", nil, "", time.Time{}, 0, false, err
+		}
+		return ds.Namespace, ds.Name, ds.Labels, metav1.FormatLabelSelector(ds.Spec.Selector), ds.CreationTimestamp.Time, ds.Generation, true, nil
+	default:
+		return "", "", nil, "", time.Time{}, 0, false, fmt.Errorf("unknown workload kind %q", item.kind)
+	}
+}
+
+// matchedWorkloads lists every Deployment, StatefulSet, and DaemonSet
+// currently in the informer caches and returns the ones matching cfg's
+// rules, mirroring redeployWorkloads' oneshot-path matching loop. sync
+// uses the full set so checkMaxUnavailablePercent gates against how many
+// matched workloads would be disrupted across the cluster, not just the
+// one workload currently being reconciled.
+func (c *Controller) matchedWorkloads(ctx context.Context) ([]matchedWorkload, error) {
+	var matched []matchedWorkload
+
+	deployments, err := c.deploymentLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %s", err.Error())
+	}
+	for _, d := range deployments {
+		rule, ok, err := matchRuleFiltered(c.cfg, c.filterLabel, d.Namespace, d.Name, d.Labels, d.CreationTimestamp.Time)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, matchedWorkload{kind: "Deployment", name: d.Name, namespace: d.Namespace, labels: metav1.FormatLabelSelector(d.Spec.Selector), rule: rule})
+		}
+	}
+
+	statefulSets, err := c.statefulSetLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %s", err.Error())
+	}
+	for _, s := range statefulSets {
+		rule, ok, err := matchRuleFiltered(c.cfg, c.filterLabel, s.Namespace, s.Name, s.Labels, s.CreationTimestamp.Time)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, matchedWorkload{kind: "StatefulSet", name: s.Name, namespace: s.Namespace, labels: metav1.FormatLabelSelector(s.Spec.Selector), rule: rule})
+		}
+	}
+
+	daemonSets, err := c.daemonSetLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %s", err.Error())
+	}
+	for _, ds := range daemonSets {
+		rule, ok, err := matchRuleFiltered(c.cfg, c.filterLabel, ds.Namespace, ds.Name, ds.Labels, ds.CreationTimestamp.Time)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, matchedWorkload{kind: "DaemonSet", name: ds.Name, namespace: ds.Namespace, labels: metav1.FormatLabelSelector(ds.Spec.Selector), rule: rule})
+		}
+	}
+
+	return matched, nil
+}
+
+// hostname is used as a leader election identity fallback.
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "k8s-redeployer"
+	}
+	return h
+}
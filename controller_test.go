@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestObjectChangedDetectsResourceVersionBump(t *testing.T) {
+	old := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "1"}}
+	new := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "2"}}
+
+	if !objectChanged(old, new) {
+		t.Error("expected a ResourceVersion change to be reported as changed")
+	}
+}
+
+func TestObjectChangedIgnoresPeriodicResync(t *testing.T) {
+	obj := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "1"}}
+
+	// client-go's periodic informer resync redelivers the same object as
+	// both old and new; objectChanged must say no so UpdateFunc doesn't
+	// enqueue it.
+	if objectChanged(obj, obj) {
+		t.Error("expected redelivery of the same object to be reported as unchanged")
+	}
+}
+
+func TestObjectChangedNonMetaObjectIsChanged(t *testing.T) {
+	// meta.Accessor fails on something that isn't a runtime/metav1 object;
+	// objectChanged should fail open (treat it as changed) rather than
+	// silently drop the event.
+	if !objectChanged("not-an-object", "also-not-an-object") {
+		t.Error("expected a non-meta.Object pair to be reported as changed")
+	}
+}
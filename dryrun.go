@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Dry-run modes for --dry-run, mirroring kubectl's --dry-run values.
+const (
+	DryRunNone   = "none"
+	DryRunClient = "client"
+	DryRunServer = "server"
+)
+
+// DryRunOptions controls whether redeployWorkload actually mutates the
+// cluster and how the patch itself is sent.
+type DryRunOptions struct {
+	// Mode is one of DryRunNone, DryRunClient, or DryRunServer.
+	Mode string
+	// ServerSideApply, when true, sends the patch as a server-side apply
+	// (types.ApplyPatchType) owned by field manager "k8s-redeployer"
+	// instead of a strategic merge patch, so concurrent controllers don't
+	// fight over the restarted_at annotation.
+	ServerSideApply bool
+}
+
+// FieldManager is the field manager used for server-side apply patches.
+const FieldManager = "k8s-redeployer"
+
+// Change describes a single planned mutation, reported instead of applied
+// when DryRunOptions.Mode is not DryRunNone.
+type Change struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// String renders c as a small unified diff of its single field.
+func (c Change) String() string {
+	return fmt.Sprintf("--- %s\n+++ %s\n-%s\n+%s", c.Field, c.Field, c.Before, c.After)
+}
+
+// planAnnotationChanges returns the Change set a patch stamping annotations
+// onto kind/name's pod template would produce, given the previously
+// recorded "restarted_at" value. For a Deployment, it also reports the
+// downstream ReplicaSet the pod template change would cause to be created.
+func planAnnotationChanges(kind, priorAnnotation string, annotations map[string]string) []Change {
+	changes := []Change{
+		{Field: "spec.template.metadata.annotations.restarted_at", Before: priorAnnotation, After: annotations["restarted_at"]},
+	}
+	for key, val := range annotations {
+		if key == "restarted_at" {
+			continue
+		}
+		changes = append(changes, Change{Field: "spec.template.metadata.annotations." + key, Before: "", After: val})
+	}
+	if kind == "Deployment" {
+		changes = append(changes, Change{Field: "ReplicaSet", Before: "", After: "new ReplicaSet would be created for the updated pod template"})
+	}
+	return changes
+}
+
+// planServerDryRunChanges is planAnnotationChanges's --dry-run=server
+// counterpart: instead of only reporting what we asked the API server to
+// change, it diffs serverAnnotations (the DryRunAll response, after
+// defaulting/admission/mutating webhooks ran) against what we requested,
+// so a mutating webhook rewriting or dropping one of our annotations shows
+// up as a planned change rather than being silently missed.
+func planServerDryRunChanges(kind, priorAnnotation string, requested, serverAnnotations map[string]string) []Change {
+	changes := []Change{
+		{Field: "spec.template.metadata.annotations.restarted_at", Before: priorAnnotation, After: serverAnnotations["restarted_at"]},
+	}
+	for key, val := range requested {
+		if key == "restarted_at" {
+			continue
+		}
+		serverVal, ok := serverAnnotations[key]
+		if !ok {
+			changes = append(changes, Change{Field: "spec.template.metadata.annotations." + key, Before: val, After: "(dropped by admission)"})
+			continue
+		}
+		changes = append(changes, Change{Field: "spec.template.metadata.annotations." + key, Before: val, After: serverVal})
+	}
+	if kind == "Deployment" {
+		changes = append(changes, Change{Field: "ReplicaSet", Before: "", After: "new ReplicaSet would be created for the updated pod template"})
+	}
+	return changes
+}
+
+// patchTypeAndOptions returns the patch type and PatchOptions to use for a
+// single patch call, based on dryRunOpts. A server dry-run sets
+// metav1.DryRunAll so the API server validates and returns the result
+// without persisting it; server-side apply switches the patch type to
+// types.ApplyPatchType under FieldManager.
+func patchTypeAndOptions(dryRunOpts DryRunOptions) (types.PatchType, metav1.PatchOptions) {
+	opts := metav1.PatchOptions{}
+	if dryRunOpts.Mode == DryRunServer {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	if dryRunOpts.ServerSideApply {
+		opts.FieldManager = FieldManager
+		force := true
+		opts.Force = &force
+		return types.ApplyPatchType, opts
+	}
+	return types.StrategicMergePatchType, opts
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestPlanAnnotationChanges(t *testing.T) {
+	changes := planAnnotationChanges("Deployment", "2024-01-01T00:00:00Z", map[string]string{
+		"restarted_at": "2024-01-02T00:00:00Z",
+	})
+
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes (restarted_at + ReplicaSet), got %d: %+v", len(changes), changes)
+	}
+	if changes[0].Before != "2024-01-01T00:00:00Z" || changes[0].After != "2024-01-02T00:00:00Z" {
+		t.Errorf("unexpected restarted_at change: %+v", changes[0])
+	}
+	if changes[1].Field != "ReplicaSet" {
+		t.Errorf("expected a ReplicaSet change for a Deployment, got %+v", changes[1])
+	}
+}
+
+func TestPlanAnnotationChangesNonDeploymentHasNoReplicaSetChange(t *testing.T) {
+	changes := planAnnotationChanges("StatefulSet", "", map[string]string{"restarted_at": "now"})
+
+	for _, c := range changes {
+		if c.Field == "ReplicaSet" {
+			t.Error("expected no ReplicaSet change for a StatefulSet")
+		}
+	}
+}
+
+func TestPlanServerDryRunChangesDetectsAdmissionMutation(t *testing.T) {
+	requested := map[string]string{"restarted_at": "now", "team": "payments"}
+	serverAnnotations := map[string]string{"restarted_at": "now", "team": "payments-mutated"}
+
+	changes := planServerDryRunChanges("Deployment", "before", requested, serverAnnotations)
+
+	var found bool
+	for _, c := range changes {
+		if c.Field == "spec.template.metadata.annotations.team" {
+			found = true
+			if c.Before != "payments" || c.After != "payments-mutated" {
+				t.Errorf("expected to see the admission-mutated value, got %+v", c)
+			}
+		}
+	}
+	if !found {
+		t.Error("expected a change entry for the team annotation")
+	}
+}
+
+func TestPlanServerDryRunChangesDetectsDroppedAnnotation(t *testing.T) {
+	requested := map[string]string{"restarted_at": "now", "team": "payments"}
+	serverAnnotations := map[string]string{"restarted_at": "now"}
+
+	changes := planServerDryRunChanges("StatefulSet", "before", requested, serverAnnotations)
+
+	var found bool
+	for _, c := range changes {
+		if c.Field == "spec.template.metadata.annotations.team" {
+			found = true
+			if c.After != "(dropped by admission)" {
+				t.Errorf("expected the dropped-by-admission marker, got %+v", c)
+			}
+		}
+	}
+	if !found {
+		t.Error("expected a change entry for the dropped team annotation")
+	}
+}
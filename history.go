@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/homedir"
+)
+
+// HistoryEntry describes one past redeployer run against a workload, as
+// recovered from its tracking labels/annotations.
+type HistoryEntry struct {
+	Kind        string
+	Namespace   string
+	Name        string
+	RunID       string
+	RestartedAt string
+}
+
+// runHistoryCommand implements `redeployer history <name>`: it looks up
+// every workload the redeployer has previously managed (tracked via
+// ManagedByLabel) with the given name and prints its last known run.
+func runHistoryCommand(args []string, logger *slog.Logger) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	var kubeconfig *string
+	if home := homedir.HomeDir(); home != "" {
+		kubeconfig = fs.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
+	} else {
+		kubeconfig = fs.String("kubeconfig", "", "absolute path to the kubeconfig file")
+	}
+	kubeContext := fs.String("context", "", "kubeconfig context to query")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		logger.Error("usage: redeployer history <name>")
+		os.Exit(1)
+	}
+	name := fs.Arg(0)
+
+	client, err := NewK8sClient(logger, *kubeconfig, *kubeContext)
+	if err != nil {
+		logger.With("error", err).Error("failed to initialize k8s client")
+		os.Exit(1)
+	}
+
+	entries, err := RunHistory(context.Background(), *client, name)
+	if err != nil {
+		logger.With("error", err).Error("failed to query run history")
+		os.Exit(1)
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("no managed runs found for %q\n", name)
+		return
+	}
+
+	for _, e := range entries {
+		fmt.Printf("%s\t%s/%s\trun-id=%s\trestarted_at=%s\n", e.Kind, e.Namespace, e.Name, e.RunID, e.RestartedAt)
+	}
+}
+
+// RunHistory lists every Deployment, StatefulSet, and DaemonSet named name
+// that carries ManagedByLabel, across all namespaces, and returns their
+// last recorded run ID and restart timestamp.
+func RunHistory(ctx context.Context, k kubernetes.Clientset, name string) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	listOpts := metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", ManagedByLabel, ManagedByValue),
+		FieldSelector: fmt.Sprintf("metadata.name=%s", name),
+	}
+
+	deployments, err := k.AppsV1().Deployments("").List(ctx, listOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %s", err.Error())
+	}
+	for _, d := range deployments.Items {
+		entries = append(entries, HistoryEntry{
+			Kind:        "Deployment",
+			Namespace:   d.Namespace,
+			Name:        d.Name,
+			RunID:       d.Labels[LastRunIDLabel],
+			RestartedAt: d.Spec.Template.Annotations["restarted_at"],
+		})
+	}
+
+	statefulSets, err := k.AppsV1().StatefulSets("").List(ctx, listOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %s", err.Error())
+	}
+	for _, s := range statefulSets.Items {
+		entries = append(entries, HistoryEntry{
+			Kind:        "StatefulSet",
+			Namespace:   s.Namespace,
+			Name:        s.Name,
+			RunID:       s.Labels[LastRunIDLabel],
+			RestartedAt: s.Spec.Template.Annotations["restarted_at"],
+		})
+	}
+
+	daemonSets, err := k.AppsV1().DaemonSets("").List(ctx, listOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %s", err.Error())
+	}
+	for _, ds := range daemonSets.Items {
+		entries = append(entries, HistoryEntry{
+			Kind:        "DaemonSet",
+			Namespace:   ds.Namespace,
+			Name:        ds.Name,
+			RunID:       ds.Labels[LastRunIDLabel],
+			RestartedAt: ds.Spec.Template.Annotations["restarted_at"],
+		})
+	}
+
+	return entries, nil
+}
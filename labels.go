@@ -0,0 +1,19 @@
+package main
+
+// Tracking labels stamped onto every workload (and its pod template) that
+// the redeployer patches, so runs can be audited and filtered without a
+// separate datastore.
+const (
+	LastRunIDLabel = "redeployer.k8s.io/last-run-id"
+	ManagedByLabel = "redeployer.k8s.io/managed-by"
+	ManagedByValue = "k8s-redeployer"
+)
+
+// trackingLabels returns the label set to stamp on a workload (and its pod
+// template) for a single redeploy run, keyed by runID.
+func trackingLabels(runID string) map[string]string {
+	return map[string]string{
+		LastRunIDLabel: runID,
+		ManagedByLabel: ManagedByValue,
+	}
+}
@@ -2,134 +2,571 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/client-go/util/homedir"
-)
 
-// assuming kubeconfig was setup via kubectl
-// add k8s contect to this const
-const k8sContext = ""
+	redeployerlog "k8s-redeployer/pkg/log"
+	"k8s-redeployer/pkg/metrics"
+)
 
 type DeploymentDetails struct {
-	Name string
-	Pods []PodDetails
+	Kind    string
+	Name    string
+	RunID   string
+	Pods    []PodDetails
+	Planned []Change
 }
 type PodDetails struct {
 	Name        string
 	RestartedOn string
+	Success     bool
+	Error       string
 }
 
 func main() {
-	logger := NewLogger()
-	k8sClient, err := NewK8sClient(logger)
-	if err != nil {
-		logger.With("error", err).Error("failed to initialize NewK8sClient()")
-		os.Exit(1)
-	}
-	logger.With("context", k8sContext).Info("k8s client created and context sucessfully loaded")
-	d, err := redeployDatabasePods(*k8sClient)
-	if err != nil {
-		logger.With("error", err).Error("failed to redeploy pods")
-		os.Exit(1)
-	}
+	logFormat := flag.String("log-format", "text", "log output format: text or json")
+	logLevel := flag.String("log-level", "info", "minimum log level: debug, info, warn, or error")
 
-	logger.With("deployment", d.Name).Info("sucessfully patched deployment")
-	for _, dd := range d.Pods {
-		logger.With("pod", dd.Name, "restarted_on", dd.RestartedOn).Info("sucessfully redeployed pod")
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		runHistoryCommand(os.Args[2:], redeployerlog.NewLogger("text", "info"))
+		return
 	}
-}
 
-// NewLogger() iniatlizes and returns a slog logger
-func NewLogger() *slog.Logger {
-	l := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
-	if l == nil {
-		log.Panic("logger failed to initialize")
-	}
-	return l
-}
+	configPath := flag.String("config", "", "path to the redeployer rules config file (YAML or JSON)")
+	oneshot := flag.Bool("oneshot", false, "evaluate rules once and exit instead of running the informer-based controller")
+	workers := flag.Int("workers", 2, "number of reconcile workers to run (controller mode only)")
+	leaderElect := flag.Bool("leader-elect", false, "run leader election so only one replica reconciles at a time")
+	leaseNamespace := flag.String("leader-elect-namespace", "default", "namespace for the leader election lease")
+	leaseName := flag.String("leader-elect-lease-name", "k8s-redeployer", "name of the leader election lease")
+	contextsFlag := flag.String("contexts", "", "comma-separated list of kubeconfig contexts to target (defaults to the kubeconfig's current-context)")
+	allContexts := flag.Bool("all-contexts", false, "target every context defined in the kubeconfig")
+	filterLabel := flag.String("filter-label", "", "only target workloads whose labels match this selector, e.g. redeployer.k8s.io/managed-by=k8s-redeployer")
+	waitForRolloutFlag := flag.Bool("wait-for-rollout", false, "after patching, block until the rollout completes (or --timeout elapses) and roll back on failure")
+	timeout := flag.Duration("timeout", 5*time.Minute, "how long to wait for a rollout to complete when --wait-for-rollout is set")
+	maxUnavailablePercent := flag.Int("max-unavailable-percent", 0, "refuse to patch if more than this percent of matched workloads are already unavailable (0 disables the guard)")
+	listenAddr := flag.String("listen", ":9090", "address to serve /metrics, /healthz, and /readyz on (controller mode only; empty disables)")
+	dryRun := flag.String("dry-run", DryRunNone, "client|server|none: preview the patch that would be applied instead of mutating the cluster")
+	serverSideApply := flag.Bool("server-side-apply", false, "apply the patch as a server-side apply owned by field manager \"k8s-redeployer\", instead of a strategic merge patch")
 
-// NewK8sClient takes slog logger as an input param and returns k8s client and nil if sucessful.
-// If an error is encourted it returns a nil client and the error.
-func NewK8sClient(logger *slog.Logger) (*kubernetes.Clientset, error) {
 	var kubeconfig *string
 	if home := homedir.HomeDir(); home != "" {
-		logger.Info("kubeconfig found in default location: '$HOME/.kube/config'")
 		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
 	} else {
-		logger.Info("kubeconfig not found. creating it in '$HOME/.kube/config'")
 		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
 	}
+
 	flag.Parse()
 
-	config, err := clientcmd.LoadFromFile(*kubeconfig)
+	logger := redeployerlog.NewLogger(*logFormat, *logLevel)
+	redeployerlog.BridgeKlog(logger)
+
+	if *configPath == "" {
+		logger.Error("--config is required")
+		os.Exit(1)
+	}
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		logger.With("error", err).Error("failed to load config")
+		os.Exit(1)
+	}
+
+	cache := NewClientCache(*kubeconfig, logger)
+
+	contexts, err := resolveContexts(cache, *contextsFlag, *allContexts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load kubeconfig from file %s", err.Error())
+		logger.With("error", err).Error("failed to resolve kubeconfig contexts")
+		os.Exit(1)
+	}
+	logger.With("contexts", contexts).Info("k8s contexts resolved")
+
+	if *dryRun != DryRunNone && *dryRun != DryRunClient && *dryRun != DryRunServer {
+		logger.With("dry-run", *dryRun).Error("--dry-run must be one of client, server, or none")
+		os.Exit(1)
 	}
+	dryRunOpts := DryRunOptions{Mode: *dryRun, ServerSideApply: *serverSideApply}
 
-	if _, exists := config.Contexts[k8sContext]; !exists {
-		return nil, fmt.Errorf("kubecontext does not exist in the kubeconfig %s", k8sContext)
+	ctx, stop := signal.NotifyContext(redeployerlog.NewContext(context.Background(), logger), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *oneshot {
+		rolloutOpts := RolloutOptions{Wait: *waitForRolloutFlag, Timeout: *timeout}
+		runOneshotAcrossContexts(ctx, cache, cfg, *filterLabel, rolloutOpts, dryRunOpts, *maxUnavailablePercent, contexts, logger)
+		return
+	}
+
+	var controllersMu sync.Mutex
+	var controllers []*Controller
+	registerController := func(c *Controller) {
+		controllersMu.Lock()
+		defer controllersMu.Unlock()
+		controllers = append(controllers, c)
 	}
 
-	config.CurrentContext = k8sContext
-	K8sConfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if *listenAddr != "" {
+		server := metrics.NewServer(*listenAddr, func() bool {
+			controllersMu.Lock()
+			defer controllersMu.Unlock()
+			if len(controllers) == 0 {
+				return false
+			}
+			for _, c := range controllers {
+				if !c.Ready() {
+					return false
+				}
+			}
+			return true
+		})
+		go func() {
+			logger.With("addr", *listenAddr).Info("starting metrics server")
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.With("error", err).Error("metrics server exited with error")
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for _, contextName := range contexts {
+		contextName := contextName
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runController(ctx, cache, cfg, *filterLabel, RolloutOptions{Wait: *waitForRolloutFlag, Timeout: *timeout}, dryRunOpts, *maxUnavailablePercent, contextName, *workers, *leaderElect, *leaseNamespace, *leaseName, logger, registerController)
+		}()
+	}
+	wg.Wait()
+}
+
+// resolveContexts returns the kubeconfig contexts to target: every context
+// from the kubeconfig if allContexts is set, the comma-separated list in
+// contextsFlag if non-empty, or the kubeconfig's current-context otherwise.
+func resolveContexts(cache *ClientCache, contextsFlag string, allContexts bool) ([]string, error) {
+	if allContexts {
+		return cache.AllContexts()
+	}
+	if contextsFlag != "" {
+		var contexts []string
+		for _, c := range strings.Split(contextsFlag, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				contexts = append(contexts, c)
+			}
+		}
+		return contexts, nil
+	}
+	current, err := cache.CurrentContext()
 	if err != nil {
 		return nil, err
 	}
-	client, err := kubernetes.NewForConfig(K8sConfig)
+	return []string{current}, nil
+}
+
+// runOneshotAcrossContexts evaluates cfg once against every context
+// concurrently and logs the result for each.
+func runOneshotAcrossContexts(ctx context.Context, cache *ClientCache, cfg Config, filterLabel string, rolloutOpts RolloutOptions, dryRunOpts DryRunOptions, maxUnavailablePercent int, contexts []string, logger *slog.Logger) {
+	var wg sync.WaitGroup
+	for _, contextName := range contexts {
+		contextName := contextName
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctxLogger := logger.With("context", contextName)
+
+			k8sClient, err := cache.ForContext(contextName)
+			if err != nil {
+				ctxLogger.With("error", err).Error("failed to initialize client for context")
+				return
+			}
+
+			workloads, err := redeployWorkloads(ctx, *k8sClient, cfg, filterLabel, rolloutOpts, dryRunOpts, maxUnavailablePercent)
+			if err != nil {
+				ctxLogger.With("error", err).Error("failed to redeploy workloads")
+				return
+			}
+			for _, d := range workloads {
+				if dryRunOpts.Mode != DryRunNone {
+					ctxLogger.With("kind", d.Kind, "deployment", d.Name).Info("dry-run: would patch workload")
+					for _, change := range d.Planned {
+						fmt.Println(change.String())
+					}
+					continue
+				}
+				ctxLogger.With("kind", d.Kind, "deployment", d.Name).Info("sucessfully patched workload")
+				for _, dd := range d.Pods {
+					ctxLogger.With("pod", dd.Name, "restarted_on", dd.RestartedOn).Info("sucessfully redeployed pod")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// runController builds a client and controller for contextName and runs it
+// until ctx is cancelled, optionally under leader election. onReady, if
+// non-nil, is called with the controller as soon as it's constructed so the
+// caller can fold it into a /readyz check.
+func runController(ctx context.Context, cache *ClientCache, cfg Config, filterLabel string, rolloutOpts RolloutOptions, dryRunOpts DryRunOptions, maxUnavailablePercent int, contextName string, workers int, leaderElect bool, leaseNamespace, leaseName string, logger *slog.Logger, onReady func(*Controller)) {
+	ctxLogger := logger.With("context", contextName)
+
+	k8sClient, err := cache.ForContext(contextName)
 	if err != nil {
-		return nil, err
+		ctxLogger.With("error", err).Error("failed to initialize client for context")
+		return
 	}
 
-	return client, nil
+	controller := NewController(*k8sClient, cfg, filterLabel, rolloutOpts, dryRunOpts, maxUnavailablePercent, ctxLogger)
+	if onReady != nil {
+		onReady(controller)
+	}
+
+	if leaderElect {
+		identity := hostname()
+		lock := &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      leaseName,
+				Namespace: leaseNamespace,
+			},
+			Client: k8sClient.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: identity,
+			},
+		}
+		if err := controller.RunWithLeaderElection(ctx, workers, lock, identity); err != nil {
+			ctxLogger.With("error", err).Error("controller exited with error")
+		}
+		return
+	}
+
+	if err := controller.Run(ctx, workers); err != nil {
+		ctxLogger.With("error", err).Error("controller exited with error")
+	}
+}
+
+// matchedWorkload pairs a workload (Deployment, StatefulSet, or DaemonSet)
+// with the rule that selected it and the pod label selector used to find
+// its pods.
+type matchedWorkload struct {
+	kind      string
+	name      string
+	namespace string
+	labels    string
+	rule      Rule
 }
 
-// redeployDatabasePods takes k8s client as an input param and returns a DeploymentDetails struct and nil if sucessful.
-// If an error is encourted it returns an empty DeploymentDetails struct and the error.
-func redeployDatabasePods(k kubernetes.Clientset) (DeploymentDetails, error) {
-	var output DeploymentDetails
-	deployments, err := k.AppsV1().Deployments("").List(context.TODO(), metav1.ListOptions{}) // searching all namespace
+// redeployWorkloads evaluates cfg's rules against every Deployment,
+// StatefulSet, and DaemonSet in the cluster and applies each matching
+// rule's strategy. It returns a DeploymentDetails entry per matched
+// workload and nil if sucessful. If an error is encourted it returns
+// whatever was collected so far and the error.
+func redeployWorkloads(ctx context.Context, k kubernetes.Clientset, cfg Config, filterLabel string, rolloutOpts RolloutOptions, dryRunOpts DryRunOptions, maxUnavailablePercent int) ([]DeploymentDetails, error) {
+	var output []DeploymentDetails
+
+	var matched []matchedWorkload
+
+	deployments, err := k.AppsV1().Deployments("").List(ctx, metav1.ListOptions{}) // searching all namespace
 	if err != nil {
-		return output, fmt.Errorf("failed to list deployment: %s", err.Error())
+		return output, fmt.Errorf("failed to list deployments: %s", err.Error())
 	}
-	deploymentsMap := make(map[string]string)
 	for _, d := range deployments.Items {
-		if strings.Contains(d.Name, "database") {
-			deploymentsMap[d.Name] = metav1.FormatLabelSelector(d.Spec.Selector) // FormatLabelSelector converts to a plain string per go docs
+		rule, ok, err := matchRuleFiltered(cfg, filterLabel, d.Namespace, d.Name, d.Labels, d.CreationTimestamp.Time)
+		if err != nil {
+			return output, err
+		}
+		if ok {
+			matched = append(matched, matchedWorkload{kind: "Deployment", name: d.Name, namespace: d.Namespace, labels: metav1.FormatLabelSelector(d.Spec.Selector), rule: rule})
 		}
 	}
 
-	for deploymentName, label := range deploymentsMap {
-		pods, err := k.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{LabelSelector: label}) // searching all namespace
+	statefulSets, err := k.AppsV1().StatefulSets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return output, fmt.Errorf("failed to list statefulsets: %s", err.Error())
+	}
+	for _, s := range statefulSets.Items {
+		rule, ok, err := matchRuleFiltered(cfg, filterLabel, s.Namespace, s.Name, s.Labels, s.CreationTimestamp.Time)
+		if err != nil {
+			return output, err
+		}
+		if ok {
+			matched = append(matched, matchedWorkload{kind: "StatefulSet", name: s.Name, namespace: s.Namespace, labels: metav1.FormatLabelSelector(s.Spec.Selector), rule: rule})
+		}
+	}
+
+	daemonSets, err := k.AppsV1().DaemonSets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return output, fmt.Errorf("failed to list daemonsets: %s", err.Error())
+	}
+	for _, ds := range daemonSets.Items {
+		rule, ok, err := matchRuleFiltered(cfg, filterLabel, ds.Namespace, ds.Name, ds.Labels, ds.CreationTimestamp.Time)
 		if err != nil {
-			return output, fmt.Errorf("failed to list pods for deployment %s: %s", deploymentName, err.Error())
+			return output, err
 		}
-		output.Name = deploymentName
+		if ok {
+			matched = append(matched, matchedWorkload{kind: "DaemonSet", name: ds.Name, namespace: ds.Namespace, labels: metav1.FormatLabelSelector(ds.Spec.Selector), rule: rule})
+		}
+	}
+
+	if err := checkMaxUnavailablePercent(ctx, k, matched, maxUnavailablePercent); err != nil {
+		return output, err
+	}
+
+	for _, w := range matched {
+		details, err := redeployWorkload(ctx, k, w, rolloutOpts, dryRunOpts)
+		if err != nil {
+			return output, err
+		}
+		output = append(output, details)
+	}
+
+	return output, nil
+}
+
+// matchRule returns the first rule in cfg that matches the given workload
+// along with ok=true, or a zero Rule and ok=false if none match.
+func matchRule(cfg Config, namespace, name string, labels map[string]string, createdAt time.Time) (Rule, bool, error) {
+	for _, rule := range cfg.Rules {
+		ok, err := rule.Matches(namespace, name, labels, createdAt)
+		if err != nil {
+			return Rule{}, false, err
+		}
+		if ok {
+			return rule, true, nil
+		}
+	}
+	return Rule{}, false, nil
+}
+
+// matchRuleFiltered is matchRule with an additional --filter-label
+// constraint: when filterLabel is non-empty, the workload's labels must
+// also satisfy it, so runs can be restricted to previously-managed
+// workloads (e.g. "redeployer.k8s.io/managed-by=k8s-redeployer").
+func matchRuleFiltered(cfg Config, filterLabel, namespace, name string, workloadLabels map[string]string, createdAt time.Time) (Rule, bool, error) {
+	if filterLabel != "" {
+		sel, err := labels.Parse(filterLabel)
+		if err != nil {
+			return Rule{}, false, fmt.Errorf("invalid --filter-label %q: %s", filterLabel, err.Error())
+		}
+		if !sel.Matches(labels.Set(workloadLabels)) {
+			return Rule{}, false, nil
+		}
+	}
+	return matchRule(cfg, namespace, name, workloadLabels, createdAt)
+}
+
+// redeployWorkload applies w.rule's strategy to the matched workload and
+// returns the resulting DeploymentDetails. When rolloutOpts.Wait is set and
+// the strategy patches the pod template (StrategyPatchAnnotation or
+// StrategyRolloutRestart), it blocks until the rollout completes and rolls
+// back to the prior "restarted_at" annotation on failure or timeout.
+// dryRunOpts.Mode of DryRunClient or DryRunServer skips mutating the
+// cluster and instead reports the would-be changes in
+// DeploymentDetails.Planned.
+func redeployWorkload(ctx context.Context, k kubernetes.Clientset, w matchedWorkload, rolloutOpts RolloutOptions, dryRunOpts DryRunOptions) (DeploymentDetails, error) {
+	runID := uuid.NewString()
+	output := DeploymentDetails{Kind: w.kind, Name: w.name, RunID: runID}
+
+	pods, err := k.CoreV1().Pods(w.namespace).List(ctx, metav1.ListOptions{LabelSelector: w.labels})
+	if err != nil {
+		metrics.RecordAPIError("list")
+		return output, fmt.Errorf("failed to list pods for %s %s: %s", w.kind, w.name, err.Error())
+	}
+
+	timeStamp := time.Now().UTC().Format(time.RFC3339)
+
+	switch w.rule.Strategy {
+	case StrategyPatchAnnotation, StrategyRolloutRestart:
+		priorAnnotation, err := currentAnnotation(ctx, k, w.kind, w.namespace, w.name)
+		if err != nil {
+			return output, fmt.Errorf("failed to read prior annotation for %s %s: %s", w.kind, w.name, err.Error())
+		}
+
+		annotations := map[string]string{"restarted_at": timeStamp}
+		for annKey, annVal := range w.rule.Annotations {
+			annotations[annKey] = annVal
+		}
+		patchData, err := buildPatchForOptions(dryRunOpts, w.kind, w.namespace, w.name, annotations, trackingLabels(runID))
+		if err != nil {
+			return output, fmt.Errorf("failed to build patch for %s %s: %s", w.kind, w.name, err.Error())
+		}
+
+		if dryRunOpts.Mode == DryRunClient {
+			output.Planned = planAnnotationChanges(w.kind, priorAnnotation, annotations)
+			return output, nil
+		}
+
+		patchType, patchOpts := patchTypeAndOptions(dryRunOpts)
+		serverAnnotations, err := patchWorkload(ctx, k, w.kind, w.namespace, w.name, patchData, patchType, patchOpts)
+		if err != nil {
+			metrics.RecordPatch(w.name, w.namespace, "error")
+			metrics.RecordAPIError("patch")
+			return output, fmt.Errorf("failed to patch %s %s: %s", w.kind, w.name, err.Error())
+		}
+
+		if dryRunOpts.Mode == DryRunServer {
+			output.Planned = planServerDryRunChanges(w.kind, priorAnnotation, annotations, serverAnnotations)
+			return output, nil
+		}
+
+		success, rolloutErr := true, error(nil)
+		if rolloutOpts.Wait {
+			rolloutStart := time.Now()
+			rolloutErr = waitForRollout(ctx, k, w.kind, w.namespace, w.name, rolloutOpts.Timeout)
+			metrics.ObserveRolloutDuration(time.Since(rolloutStart))
+			if rolloutErr != nil {
+				success = false
+				rollbackAnnotations := map[string]string{"restarted_at": priorAnnotation}
+				rollbackPatch, err := buildPatchForOptions(dryRunOpts, w.kind, w.namespace, w.name, rollbackAnnotations, trackingLabels(runID))
+				if err != nil {
+					metrics.RecordPatch(w.name, w.namespace, "error")
+					return output, fmt.Errorf("rollout failed for %s %s (%s) and rollback patch could not be built: %s", w.kind, w.name, rolloutErr.Error(), err.Error())
+				}
+				rollbackType, rollbackOpts := patchTypeAndOptions(DryRunOptions{ServerSideApply: dryRunOpts.ServerSideApply})
+				if _, err := patchWorkload(ctx, k, w.kind, w.namespace, w.name, rollbackPatch, rollbackType, rollbackOpts); err != nil {
+					metrics.RecordPatch(w.name, w.namespace, "error")
+					metrics.RecordAPIError("patch")
+					return output, fmt.Errorf("rollout failed for %s %s (%s) and rollback failed: %s", w.kind, w.name, rolloutErr.Error(), err.Error())
+				}
+			}
+		}
+		if success {
+			metrics.RecordPatch(w.name, w.namespace, "success")
+		} else {
+			metrics.RecordPatch(w.name, w.namespace, "error")
+		}
+
 		for _, pod := range pods.Items {
-			timeStamp := time.Now().UTC().Format(time.RFC3339)
-			patchData := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"restarted_at":"%s"}}}}}`, timeStamp)
-			_, err := k.AppsV1().Deployments(pod.Namespace).Patch(context.TODO(), deploymentName, types.StrategicMergePatchType, []byte(patchData), metav1.PatchOptions{})
-			if err != nil {
-				return output, fmt.Errorf("failed to patch deployment %s for pod %s: %s", deploymentName, pod.Name, err.Error())
+			detail := PodDetails{Name: pod.Name, RestartedOn: timeStamp, Success: success}
+			if rolloutErr != nil {
+				detail.Error = rolloutErr.Error()
 			}
-			podDetail := PodDetails{
-				Name:        pod.Name,
-				RestartedOn: timeStamp,
+			output.Pods = append(output.Pods, detail)
+		}
+	case StrategyDeletePod:
+		if dryRunOpts.Mode != DryRunNone {
+			for _, pod := range pods.Items {
+				output.Planned = append(output.Planned, Change{Field: "pod/" + pod.Name, Before: "running", After: "deleted (forces restart)"})
 			}
-			output.Pods = append(output.Pods, podDetail)
+			return output, nil
 		}
-
+		for _, pod := range pods.Items {
+			detail := PodDetails{Name: pod.Name, RestartedOn: timeStamp, Success: true}
+			if err := k.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
+				metrics.RecordAPIError("delete")
+				detail.Success = false
+				detail.Error = err.Error()
+			}
+			output.Pods = append(output.Pods, detail)
+		}
+	default:
+		return output, fmt.Errorf("unknown strategy %q for %s %s", w.rule.Strategy, w.kind, w.name)
 	}
+
 	return output, nil
 }
+
+// buildPatch builds the strategic merge patch that stamps annotations and
+// the redeployer tracking labels onto both the workload itself and its pod
+// template.
+func buildPatch(annotations, trackingLabels map[string]string) ([]byte, error) {
+	patch := map[string]any{
+		"metadata": map[string]any{
+			"labels": trackingLabels,
+		},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"annotations": annotations,
+					"labels":      trackingLabels,
+				},
+			},
+		},
+	}
+	return json.Marshal(patch)
+}
+
+// apiVersionForKind returns the apps/v1 GroupVersion string for the
+// workload kinds this tool manages, all of which live there.
+func apiVersionForKind(kind string) string {
+	return "apps/v1"
+}
+
+// buildApplyPatch builds the server-side apply payload for kind/name in
+// namespace, stamping the same annotations and tracking labels as
+// buildPatch. Unlike a strategic merge patch, a server-side apply body must
+// carry its own apiVersion/kind (and identify the object by name/namespace)
+// so the API server can run it through structured-merge-diff.
+func buildApplyPatch(kind, namespace, name string, annotations, trackingLabels map[string]string) ([]byte, error) {
+	patch := map[string]any{
+		"apiVersion": apiVersionForKind(kind),
+		"kind":       kind,
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    trackingLabels,
+		},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"annotations": annotations,
+					"labels":      trackingLabels,
+				},
+			},
+		},
+	}
+	return json.Marshal(patch)
+}
+
+// buildPatchForOptions picks buildPatch or buildApplyPatch based on
+// dryRunOpts.ServerSideApply, so callers don't need to branch themselves.
+func buildPatchForOptions(dryRunOpts DryRunOptions, kind, namespace, name string, annotations, trackingLabels map[string]string) ([]byte, error) {
+	if dryRunOpts.ServerSideApply {
+		return buildApplyPatch(kind, namespace, name, annotations, trackingLabels)
+	}
+	return buildPatch(annotations, trackingLabels)
+}
+
+// patchWorkload patches the named workload of the given kind ("Deployment",
+// "StatefulSet", or "DaemonSet") in namespace using patchType and opts, as
+// built by patchTypeAndOptions. It returns the pod template annotations of
+// the object the API server handed back, which for a DryRunAll request is
+// the result of server-side defaulting and admission, not just patchData
+// echoed back.
+func patchWorkload(ctx context.Context, k kubernetes.Clientset, kind, namespace, name string, patchData []byte, patchType types.PatchType, opts metav1.PatchOptions) (map[string]string, error) {
+	switch kind {
+	case "Deployment":
+		d, err := k.AppsV1().Deployments(namespace).Patch(ctx, name, patchType, patchData, opts)
+		if err != nil {
+			return nil, err
+		}
+		return d.Spec.Template.Annotations, nil
+	case "StatefulSet":
+		s, err := k.AppsV1().StatefulSets(namespace).Patch(ctx, name, patchType, patchData, opts)
+		if err != nil {
+			return nil, err
+		}
+		return s.Spec.Template.Annotations, nil
+	case "DaemonSet":
+		ds, err := k.AppsV1().DaemonSets(namespace).Patch(ctx, name, patchType, patchData, opts)
+		if err != nil {
+			return nil, err
+		}
+		return ds.Spec.Template.Annotations, nil
+	default:
+		return nil, fmt.Errorf("unknown workload kind %q", kind)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchRuleReturnsFirstMatch(t *testing.T) {
+	cfg := Config{Rules: []Rule{
+		{Namespace: "staging", Strategy: StrategyDeletePod},
+		{Namespace: "*", Strategy: StrategyRolloutRestart},
+	}}
+
+	rule, ok, err := matchRule(cfg, "staging", "api", nil, time.Time{})
+	if err != nil {
+		t.Fatalf("matchRule returned error: %s", err)
+	}
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if rule.Strategy != StrategyDeletePod {
+		t.Errorf("expected the staging-specific rule to win, got strategy %q", rule.Strategy)
+	}
+
+	rule, ok, err = matchRule(cfg, "prod", "api", nil, time.Time{})
+	if err != nil {
+		t.Fatalf("matchRule returned error: %s", err)
+	}
+	if !ok {
+		t.Fatal("expected the catch-all rule to match")
+	}
+	if rule.Strategy != StrategyRolloutRestart {
+		t.Errorf("expected the catch-all rule, got strategy %q", rule.Strategy)
+	}
+}
+
+func TestMatchRuleNoMatch(t *testing.T) {
+	cfg := Config{Rules: []Rule{{Namespace: "staging"}}}
+
+	_, ok, err := matchRule(cfg, "prod", "api", nil, time.Time{})
+	if err != nil {
+		t.Fatalf("matchRule returned error: %s", err)
+	}
+	if ok {
+		t.Error("expected no rule to match")
+	}
+}
+
+func TestMatchRuleFilteredAppliesFilterLabel(t *testing.T) {
+	cfg := Config{Rules: []Rule{{Namespace: "*"}}}
+
+	_, ok, err := matchRuleFiltered(cfg, "redeployer.k8s.io/managed-by=k8s-redeployer", "default", "api", nil, time.Time{})
+	if err != nil {
+		t.Fatalf("matchRuleFiltered returned error: %s", err)
+	}
+	if ok {
+		t.Error("expected workload without the filter label not to match")
+	}
+
+	_, ok, err = matchRuleFiltered(cfg, "redeployer.k8s.io/managed-by=k8s-redeployer", "default", "api", map[string]string{"redeployer.k8s.io/managed-by": "k8s-redeployer"}, time.Time{})
+	if err != nil {
+		t.Fatalf("matchRuleFiltered returned error: %s", err)
+	}
+	if !ok {
+		t.Error("expected workload with the filter label to match")
+	}
+}
+
+func TestMatchRuleFilteredInvalidFilterLabel(t *testing.T) {
+	cfg := Config{Rules: []Rule{{Namespace: "*"}}}
+
+	_, _, err := matchRuleFiltered(cfg, "not a valid selector!!", "default", "api", nil, time.Time{})
+	if err == nil {
+		t.Error("expected an error for an invalid --filter-label selector")
+	}
+}
@@ -0,0 +1,125 @@
+// Package log provides the redeployer's structured logger: a context-
+// carried *slog.Logger with selectable text/JSON output, and a bridge that
+// routes client-go's klog output through the same handler.
+package log
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+)
+
+type contextKey struct{}
+
+// NewLogger builds the redeployer's top-level logger. format selects the
+// slog.Handler ("json" or "text", default "text"); level selects the
+// minimum level logged ("debug", "info", "warn", "error", default "info").
+func NewLogger(format, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: parseLevel(level)}
+
+	var handler slog.Handler
+	switch format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	default:
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+
+	l := slog.New(handler)
+	if l == nil {
+		log.Panic("logger failed to initialize")
+	}
+	return l
+}
+
+func parseLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// NewContext returns a copy of ctx carrying l, retrievable with
+// FromContext.
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or slog.Default() if ctx
+// carries none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// BridgeKlog routes client-go's internal klog output through l, so
+// kubeconfig/auth errors surface in the same structured stream as the
+// rest of the redeployer's logs.
+//
+// logr gained a ready-made slog adapter (logr.FromSlogHandler) in v1.4.1,
+// but client-go's transitive requirement only floors logr at v1.3.0, so we
+// can't rely on that without a go.mod pinning the newer version. slogSink
+// is a small hand-rolled logr.LogSink that works against the stable v1.3.0
+// interface instead.
+func BridgeKlog(l *slog.Logger) {
+	klog.SetLogger(logr.New(slogSink{handler: l.Handler()}))
+}
+
+// slogSink adapts a slog.Handler to logr.LogSink, so klog's logr.Logger can
+// write through the same handler as the rest of the redeployer's logs.
+type slogSink struct {
+	handler slog.Handler
+}
+
+func (s slogSink) Init(logr.RuntimeInfo) {}
+
+func (s slogSink) Enabled(int) bool {
+	return s.handler.Enabled(context.Background(), slog.LevelInfo)
+}
+
+func (s slogSink) Info(_ int, msg string, keysAndValues ...any) {
+	s.emit(slog.LevelInfo, msg, nil, keysAndValues)
+}
+
+func (s slogSink) Error(err error, msg string, keysAndValues ...any) {
+	s.emit(slog.LevelError, msg, err, keysAndValues)
+}
+
+func (s slogSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return slogSink{handler: s.handler.WithAttrs(attrsFromPairs(keysAndValues))}
+}
+
+func (s slogSink) WithName(name string) logr.LogSink {
+	return slogSink{handler: s.handler.WithAttrs([]slog.Attr{slog.String("logger", name)})}
+}
+
+func (s slogSink) emit(level slog.Level, msg string, err error, keysAndValues []any) {
+	record := slog.NewRecord(time.Now(), level, msg, 0)
+	if err != nil {
+		record.AddAttrs(slog.Any("error", err))
+	}
+	record.Add(keysAndValues...)
+	_ = s.handler.Handle(context.Background(), record)
+}
+
+func attrsFromPairs(keysAndValues []any) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key, _ := keysAndValues[i].(string)
+		attrs = append(attrs, slog.Any(key, keysAndValues[i+1]))
+	}
+	return attrs
+}
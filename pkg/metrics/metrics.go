@@ -0,0 +1,94 @@
+// Package metrics exposes the redeployer's Prometheus instrumentation and
+// the HTTP server that serves /metrics, /healthz, and /readyz for
+// long-running (controller) mode.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// PatchesTotal counts every patch attempt, labeled by deployment,
+	// namespace, and outcome ("success" or "error"), so operators can alert
+	// on a rising failure rate.
+	PatchesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redeployer_patches_total",
+		Help: "Total number of workload patch attempts, by deployment, namespace, and result.",
+	}, []string{"deployment", "namespace", "result"})
+
+	// RolloutDuration observes how long redeployer waited for a patched
+	// workload's rollout to complete, when --wait-for-rollout is set.
+	RolloutDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "redeployer_rollout_duration_seconds",
+		Help:    "Time spent waiting for a patched workload's rollout to complete.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// APIErrorsTotal counts Kubernetes API errors encountered while
+	// reconciling, labeled by the verb that failed (list, get, patch, delete).
+	APIErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redeployer_api_errors_total",
+		Help: "Total number of Kubernetes API errors encountered, by verb.",
+	}, []string{"verb"})
+
+	// liveness is set to the current time on every successful controller
+	// reconcile, mirroring skia/k8s-deployer's livenessMetric: a
+	// scrape-and-alert staleness check independent of process-level health.
+	liveness = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "redeployer_controller_last_reconcile_timestamp_seconds",
+		Help: "Unix timestamp of the last successful controller reconcile.",
+	})
+)
+
+// RecordPatch records the outcome ("success" or "error") of a patch attempt
+// against deployment in namespace.
+func RecordPatch(deployment, namespace, result string) {
+	PatchesTotal.WithLabelValues(deployment, namespace, result).Inc()
+}
+
+// ObserveRolloutDuration records how long a rollout wait took.
+func ObserveRolloutDuration(d time.Duration) {
+	RolloutDuration.Observe(d.Seconds())
+}
+
+// RecordAPIError records a failed Kubernetes API call for verb (e.g.
+// "list", "get", "patch", "delete").
+func RecordAPIError(verb string) {
+	APIErrorsTotal.WithLabelValues(verb).Inc()
+}
+
+// MarkAlive updates the liveness gauge to the current time, signalling that
+// a controller is still making reconcile progress.
+func MarkAlive() {
+	liveness.SetToCurrentTime()
+}
+
+// ReadyFunc reports whether the process is ready to serve traffic (e.g. all
+// controllers' informer caches have synced). A nil ReadyFunc is always
+// ready.
+type ReadyFunc func() bool
+
+// NewServer builds the HTTP server that exposes /metrics, /healthz, and
+// /readyz on addr. ready is consulted on every /readyz request.
+func NewServer(addr string, ready ReadyFunc) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if ready != nil && !ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	return &http.Server{Addr: addr, Handler: mux}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RolloutOptions controls the post-patch readiness gating and rollback
+// behavior of redeployWorkload.
+type RolloutOptions struct {
+	// Wait, when true, blocks after patching until the workload reports a
+	// completed rollout or Timeout elapses.
+	Wait    bool
+	Timeout time.Duration
+}
+
+// waitForRollout polls kind/namespace/name's status, mirroring `kubectl
+// rollout status`, until it reports fully rolled out or timeout elapses.
+// It returns nil once rolled out, or an error describing why it didn't
+// (timeout or a Progressing=False/ProgressDeadlineExceeded condition).
+func waitForRollout(ctx context.Context, k kubernetes.Clientset, kind, namespace, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		switch kind {
+		case "Deployment":
+			d, err := k.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return deploymentRolledOut(d)
+		case "StatefulSet":
+			s, err := k.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return s.Status.ObservedGeneration >= s.Generation && s.Status.UpdatedReplicas == s.Status.Replicas && s.Status.ReadyReplicas == s.Status.Replicas, nil
+		case "DaemonSet":
+			ds, err := k.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return ds.Status.ObservedGeneration >= ds.Generation && ds.Status.UpdatedNumberScheduled == ds.Status.DesiredNumberScheduled && ds.Status.NumberAvailable == ds.Status.DesiredNumberScheduled, nil
+		default:
+			return false, fmt.Errorf("unknown workload kind %q", kind)
+		}
+	})
+}
+
+// deploymentRolledOut mirrors the checks `kubectl rollout status` performs
+// against a Deployment's status.
+func deploymentRolledOut(d *appsv1.Deployment) (bool, error) {
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return false, fmt.Errorf("deployment %s exceeded its progress deadline", d.Name)
+		}
+	}
+
+	if d.Status.ObservedGeneration < d.Generation {
+		return false, nil
+	}
+	if d.Spec.Replicas != nil && d.Status.UpdatedReplicas < *d.Spec.Replicas {
+		return false, nil
+	}
+	if d.Status.Replicas > d.Status.UpdatedReplicas {
+		return false, nil
+	}
+	if d.Status.AvailableReplicas < d.Status.UpdatedReplicas {
+		return false, nil
+	}
+	return true, nil
+}
+
+// currentAnnotation returns the existing "restarted_at" pod template
+// annotation for the named workload, so a failed rollout can be rolled
+// back to it.
+func currentAnnotation(ctx context.Context, k kubernetes.Clientset, kind, namespace, name string) (string, error) {
+	switch kind {
+	case "Deployment":
+		d, err := k.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return d.Spec.Template.Annotations["restarted_at"], nil
+	case "StatefulSet":
+		s, err := k.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return s.Spec.Template.Annotations["restarted_at"], nil
+	case "DaemonSet":
+		ds, err := k.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return ds.Spec.Template.Annotations["restarted_at"], nil
+	default:
+		return "", fmt.Errorf("unknown workload kind %q", kind)
+	}
+}
+
+// countUnavailable returns, out of the matched workloads of kind total,
+// how many currently have unavailable replicas per their latest observed
+// status.
+func countUnavailable(ctx context.Context, k kubernetes.Clientset, matched []matchedWorkload) (unavailable, total int, err error) {
+	for _, w := range matched {
+		total++
+		switch w.kind {
+		case "Deployment":
+			d, err := k.AppsV1().Deployments(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+			if err != nil {
+				return 0, 0, err
+			}
+			if d.Spec.Replicas != nil && d.Status.AvailableReplicas < *d.Spec.Replicas {
+				unavailable++
+			}
+		case "StatefulSet":
+			s, err := k.AppsV1().StatefulSets(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+			if err != nil {
+				return 0, 0, err
+			}
+			if s.Spec.Replicas != nil && s.Status.ReadyReplicas < *s.Spec.Replicas {
+				unavailable++
+			}
+		case "DaemonSet":
+			ds, err := k.AppsV1().DaemonSets(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+			if err != nil {
+				return 0, 0, err
+			}
+			if ds.Status.NumberAvailable < ds.Status.DesiredNumberScheduled {
+				unavailable++
+			}
+		}
+	}
+	return unavailable, total, nil
+}
+
+// checkMaxUnavailablePercent refuses the batch if more than maxPercent of
+// the matched workloads are already unavailable. It does not estimate how
+// many more the patch itself would make unavailable.
+func checkMaxUnavailablePercent(ctx context.Context, k kubernetes.Clientset, matched []matchedWorkload, maxPercent int) error {
+	if maxPercent <= 0 || maxPercent >= 100 {
+		return nil
+	}
+
+	unavailable, total, err := countUnavailable(ctx, k, matched)
+	if err != nil {
+		return fmt.Errorf("failed to check current availability: %s", err.Error())
+	}
+	if total == 0 {
+		return nil
+	}
+
+	percent := (unavailable * 100) / total
+	if percent > maxPercent {
+		return fmt.Errorf("refusing to patch: %d%% of matched workloads are already unavailable, exceeding --max-unavailable-percent=%d", percent, maxPercent)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func deploymentFixture() *appsv1.Deployment {
+	replicas := int32(3)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           3,
+			UpdatedReplicas:    3,
+			AvailableReplicas:  3,
+		},
+	}
+}
+
+func TestDeploymentRolledOutComplete(t *testing.T) {
+	ok, err := deploymentRolledOut(deploymentFixture())
+	if err != nil {
+		t.Fatalf("deploymentRolledOut returned error: %s", err)
+	}
+	if !ok {
+		t.Error("expected a fully-updated, fully-available deployment to be rolled out")
+	}
+}
+
+func TestDeploymentRolledOutStillUpdating(t *testing.T) {
+	d := deploymentFixture()
+	d.Status.UpdatedReplicas = 1
+
+	ok, err := deploymentRolledOut(d)
+	if err != nil {
+		t.Fatalf("deploymentRolledOut returned error: %s", err)
+	}
+	if ok {
+		t.Error("expected a deployment with pending updated replicas not to be rolled out")
+	}
+}
+
+func TestDeploymentRolledOutObservedGenerationBehind(t *testing.T) {
+	d := deploymentFixture()
+	d.Status.ObservedGeneration = 1
+
+	ok, err := deploymentRolledOut(d)
+	if err != nil {
+		t.Fatalf("deploymentRolledOut returned error: %s", err)
+	}
+	if ok {
+		t.Error("expected a deployment whose controller hasn't observed the latest spec not to be rolled out")
+	}
+}
+
+func TestDeploymentRolledOutProgressDeadlineExceeded(t *testing.T) {
+	d := deploymentFixture()
+	d.Status.Conditions = []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"},
+	}
+
+	_, err := deploymentRolledOut(d)
+	if err == nil {
+		t.Error("expected an error when the deployment exceeded its progress deadline")
+	}
+}